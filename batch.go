@@ -0,0 +1,278 @@
+package pg
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// batchTarget tracks the per-address state a BatchPinger needs to match an
+// incoming reply back to the address it was sent to.
+type batchTarget struct {
+	addr     *net.IPAddr
+	ipv4     bool
+	sequence int
+}
+
+// BatchPinger pings many addresses concurrently over a single ICMP socket
+// per address family, rather than one socket per target. It is built for
+// fleets of hosts (e.g. AnyEvent::FastPing-style liveness sweeps) where
+// opening a socket per target doesn't scale.
+type BatchPinger struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	MaxRTT   time.Duration
+	Source4  string
+	Source6  string
+	Tracker  int64
+
+	OnRecv func(addr *net.IPAddr, rtt time.Duration)
+	OnIdle func()
+
+	id       int
+	done     chan bool
+	stopOnce sync.Once
+
+	mu      sync.Mutex
+	targets map[string]*batchTarget
+}
+
+// NewBatchPinger returns a new BatchPinger with no targets.
+func NewBatchPinger() *BatchPinger {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &BatchPinger{
+		Interval: time.Second,
+		Timeout:  time.Second * 100,
+		MaxRTT:   time.Second,
+		id:       r.Intn(math.MaxInt16),
+		Tracker:  r.Int63n(math.MaxInt64),
+		done:     make(chan bool),
+		targets:  make(map[string]*batchTarget),
+	}
+}
+
+// AddIPAddr adds addr to the set of targets pinged on the next round. It is
+// safe to call while RunLoop is running.
+func (b *BatchPinger) AddIPAddr(addr *net.IPAddr) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.targets[addr.IP.String()] = &batchTarget{addr: addr, ipv4: isIPv4(addr.IP)}
+}
+
+// RemoveIPAddr removes addr from the set of targets pinged on the next
+// round. It is safe to call while RunLoop is running.
+func (b *BatchPinger) RemoveIPAddr(addr *net.IPAddr) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.targets, addr.IP.String())
+}
+
+// Stop ends a running RunLoop. It is safe to call more than once and from a
+// different goroutine than the one running RunLoop.
+func (b *BatchPinger) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.done)
+	})
+}
+
+// Run sends a single echo request to every target and waits up to MaxRTT
+// for replies, invoking OnRecv for each one and OnIdle once the window
+// closes.
+func (b *BatchPinger) Run() error {
+	conn4, conn6, err := b.listen()
+	if err != nil {
+		return err
+	}
+	if conn4 != nil {
+		defer conn4.Close()
+	}
+	if conn6 != nil {
+		defer conn6.Close()
+	}
+	return b.runRound(conn4, conn6)
+}
+
+// RunLoop runs rounds of Run every Interval until Stop is called or Timeout
+// elapses.
+func (b *BatchPinger) RunLoop() error {
+	conn4, conn6, err := b.listen()
+	if err != nil {
+		return err
+	}
+	if conn4 != nil {
+		defer conn4.Close()
+	}
+	if conn6 != nil {
+		defer conn6.Close()
+	}
+
+	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
+	timeout := time.NewTimer(b.Timeout)
+	defer timeout.Stop()
+
+	for {
+		if err := b.runRound(conn4, conn6); err != nil {
+			return err
+		}
+		select {
+		case <-b.done:
+			return nil
+		case <-timeout.C:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// listen opens the raw ICMP sockets shared by every target of a given
+// address family. Both are opened up front since targets may be added to
+// either family at any time via AddIPAddr.
+func (b *BatchPinger) listen() (conn4, conn6 *icmp.PacketConn, err error) {
+	conn4, err = icmp.ListenPacket(ipv4Proto["ip"], b.Source4)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listening for ICMPv4 packets: %w", err)
+	}
+	conn6, err = icmp.ListenPacket(ipv6Proto["ip"], b.Source6)
+	if err != nil {
+		conn4.Close()
+		return nil, nil, fmt.Errorf("error listening for ICMPv6 packets: %w", err)
+	}
+	return conn4, conn6, nil
+}
+
+func (b *BatchPinger) runRound(conn4, conn6 *icmp.PacketConn) error {
+	b.mu.Lock()
+	targets := make([]*batchTarget, 0, len(b.targets))
+	for _, t := range b.targets {
+		targets = append(targets, t)
+	}
+	b.mu.Unlock()
+
+	for _, t := range targets {
+		conn := conn4
+		if !t.ipv4 {
+			conn = conn6
+		}
+		// listen opens both sockets or fails, so conn is not nil here; the
+		// check only guards against a nil socket being passed in.
+		if conn == nil {
+			continue
+		}
+		b.sendICMP(conn, t)
+	}
+
+	deadline := time.Now().Add(b.MaxRTT)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go b.recvLoop(conn4, protocolICMP, deadline, &wg)
+	go b.recvLoop(conn6, protocolIPv6ICMP, deadline, &wg)
+	wg.Wait()
+
+	if handler := b.OnIdle; handler != nil {
+		handler()
+	}
+	return nil
+}
+
+func (b *BatchPinger) sendICMP(conn *icmp.PacketConn, t *batchTarget) {
+	typ := icmp.Type(ipv4.ICMPTypeEcho)
+	if !t.ipv4 {
+		typ = ipv6.ICMPTypeEchoRequest
+	}
+
+	data := append(timeToBytes(time.Now()), intToBytes(b.Tracker)...)
+	msg := &icmp.Message{
+		Type: typ,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:   b.id,
+			Seq:  t.sequence,
+			Data: data,
+		},
+	}
+
+	msgBytes, err := msg.Marshal(nil)
+	if err != nil {
+		return
+	}
+	if _, err := conn.WriteTo(msgBytes, t.addr); err != nil {
+		return
+	}
+	t.sequence++
+}
+
+// recvLoop drains conn for the given protocol until deadline passes,
+// dispatching each reply by source IP + (id, seq) into the matching
+// target's state.
+func (b *BatchPinger) recvLoop(conn *icmp.PacketConn, proto int, deadline time.Time, wg *sync.WaitGroup) {
+	defer wg.Done()
+	if conn == nil {
+		return
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(remaining))
+
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		select {
+		case <-b.done:
+			return
+		default:
+		}
+
+		b.processReply(proto, peer, buf[:n])
+	}
+}
+
+func (b *BatchPinger) processReply(proto int, peer net.Addr, data []byte) {
+	m, err := icmp.ParseMessage(proto, data)
+	if err != nil {
+		return
+	}
+	if m.Type != ipv4.ICMPTypeEchoReply && m.Type != ipv6.ICMPTypeEchoReply {
+		return
+	}
+
+	pkt, ok := m.Body.(*icmp.Echo)
+	if !ok || pkt.ID != b.id || len(pkt.Data) < timeSliceLen+trackerLen {
+		return
+	}
+	if bytesToInt(pkt.Data[timeSliceLen:timeSliceLen+trackerLen]) != b.Tracker {
+		return
+	}
+
+	host, ok := peer.(*net.IPAddr)
+	if !ok {
+		return
+	}
+
+	b.mu.Lock()
+	t, known := b.targets[host.IP.String()]
+	matched := known && t.sequence > 0 && pkt.Seq == t.sequence-1
+	b.mu.Unlock()
+	if !matched {
+		return
+	}
+
+	rtt := time.Since(bytesToTime(pkt.Data[:timeSliceLen]))
+	if handler := b.OnRecv; handler != nil {
+		handler(t.addr, rtt)
+	}
+}
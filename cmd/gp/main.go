@@ -0,0 +1,48 @@
+// Command gp runs the check runner: it reads a config file describing
+// groups of hosts and their checks, then monitors all of them until
+// interrupted.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/frzam/gp/pkg/runner"
+)
+
+func main() {
+	configPath := flag.String("config", "/etc/gp/gprc", "path to the gp config file")
+	flag.Parse()
+
+	f, err := os.Open(*configPath)
+	if err != nil {
+		log.Fatalf("gp: %v", err)
+	}
+	defer f.Close()
+
+	cfg, err := runner.ParseConfig(f)
+	if err != nil {
+		log.Fatalf("gp: %v", err)
+	}
+
+	r := runner.NewRunner(cfg)
+	r.OnStateChange = func(sc runner.StateChange) {
+		status := "DOWN"
+		if sc.Up {
+			status = "UP"
+		}
+		fmt.Printf("%s %s/%s is %s\n", time.Now().Format(time.RFC3339), sc.Group, sc.Host, status)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := r.Run(ctx); err != nil {
+		log.Fatalf("gp: %v", err)
+	}
+}
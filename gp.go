@@ -1,10 +1,15 @@
 package pg
 
 import (
-	"log"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"math"
 	"math/rand"
 	"net"
+	"os"
+	"sync"
 	"time"
 
 	"golang.org/x/net/icmp"
@@ -38,6 +43,11 @@ type Pinger struct {
 	Tracker        int64
 	Source         string
 	done           chan bool
+	stopOnce       sync.Once
+
+	// mu guards PacketsSent, PacketsRecieve and rtts, which Run mutates
+	// from its own goroutine while GenerateStats may be read from another.
+	mu sync.Mutex
 
 	rtts     []time.Duration
 	ipaddr   *net.IPAddr
@@ -73,6 +83,14 @@ type Stats struct {
 	StdDevRtt      time.Duration
 }
 
+// packet bundles a raw read from the socket together with the control
+// message data (currently just the TTL/hop limit) it arrived with.
+type packet struct {
+	bytes  []byte
+	nbytes int
+	ttl    int
+}
+
 // NewPinger returns a new Pinger.
 func NewPinger(addr string) (*Pinger, error) {
 	ipaddr, err := net.ResolveIPAddr("ip", addr)
@@ -103,30 +121,91 @@ func isIPv4(ip net.IP) bool {
 	return net.IPv4len == len(ip.To4())
 }
 
-func (p *Pinger) Run() {
+// Run resolves a socket for the target's address family, then drives the
+// ICMP echo request/reply protocol until Count requests have been answered,
+// Timeout elapses, or Stop is called.
+func (p *Pinger) Run() error {
+	if p.Interval <= 0 {
+		return fmt.Errorf("pg: Interval must be positive, got %s", p.Interval)
+	}
+
 	var conn *icmp.PacketConn
+	var err error
 	if p.ipv4 {
-		conn = p.listen(ipv4Proto[p.network])
-		if conn == nil {
-			return
+		if conn, err = p.listen(ipv4Proto[p.network]); err != nil {
+			return err
 		}
 		conn.IPv4PacketConn().SetControlMessage(ipv4.FlagTTL, true)
 	} else {
-		conn = p.listen(ipv6Proto[p.network])
-		if conn == nil {
-			return
+		if conn, err = p.listen(ipv6Proto[p.network]); err != nil {
+			return err
 		}
 		conn.IPv6PacketConn().SetControlMessage(ipv6.FlagHopLimit, true)
 	}
 	defer conn.Close()
 	defer p.finish()
+
+	recv := make(chan *packet, 5)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go p.recvICMP(conn, recv, &wg)
+
+	if err := p.sendICMP(conn); err != nil {
+		return err
+	}
+
+	timeout := time.NewTimer(p.Timeout)
+	defer timeout.Stop()
+	interval := time.NewTicker(p.Interval)
+	defer interval.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			wg.Wait()
+			return nil
+		case <-timeout.C:
+			p.Stop()
+			wg.Wait()
+			return nil
+		case r := <-recv:
+			p.processPacket(r)
+		case <-interval.C:
+			if p.Count > 0 && p.packetsSent() >= p.Count {
+				continue
+			}
+			if err := p.sendICMP(conn); err != nil {
+				return err
+			}
+		}
+		if p.Count > 0 && p.packetsRecieve() >= p.Count {
+			p.Stop()
+			wg.Wait()
+			return nil
+		}
+	}
 }
 
-// GenerateStats returns the statistics of the pinger. This can be run while
-// Pinger is runnig or after it is finished.
-// OnFinish calls this func to get its finished stats.
+// Stop terminates an in-progress Run. It is safe to call more than once and
+// from a different goroutine than the one running Run.
+func (p *Pinger) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.done)
+	})
+}
+
+// GenerateStats returns the statistics of the pinger. It is safe to call
+// concurrently with a running Run, either while Pinger is running or after
+// it has finished. OnFinish calls this func to get its finished stats.
 func (p *Pinger) GenerateStats() *Stats {
-	loss := float64(p.PacketsSent-p.PacketsRecieve) / float64(p.PacketsSent) * 100
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var loss float64
+	if p.PacketsSent > 0 {
+		loss = float64(p.PacketsSent-p.PacketsRecieve) / float64(p.PacketsSent) * 100
+	}
 	var min, max, total time.Duration
 
 	if len(p.rtts) > 0 {
@@ -163,6 +242,21 @@ func (p *Pinger) GenerateStats() *Stats {
 	return &s
 }
 
+// packetsSent and packetsRecieve return PacketsSent/PacketsRecieve under
+// mu, so Run's own loop observes the same synchronized values GenerateStats
+// does from another goroutine.
+func (p *Pinger) packetsSent() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.PacketsSent
+}
+
+func (p *Pinger) packetsRecieve() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.PacketsRecieve
+}
+
 // finish method is called after the pinger stops.
 func (p *Pinger) finish() {
 	handler := p.OnFinish
@@ -172,12 +266,230 @@ func (p *Pinger) finish() {
 	}
 }
 
-func (p *Pinger) listen(netProto string) *icmp.PacketConn {
+func (p *Pinger) listen(netProto string) (*icmp.PacketConn, error) {
 	conn, err := icmp.ListenPacket(netProto, p.Source)
 	if err != nil {
-		log.Println("Error listening for ICMP Packets: %s\n", err.Error())
-		close(p.done)
-		return nil
+		p.Stop()
+		if p.network == "ip" && errors.Is(err, os.ErrPermission) {
+			return nil, fmt.Errorf("insufficient privileges for raw ICMP socket %q; call SetPrivileged(false) to use unprivileged ICMP-over-UDP instead, or run with elevated privileges: %w", netProto, err)
+		}
+		return nil, fmt.Errorf("error listening for ICMP packets: %w", err)
+	}
+	if p.network == "udp" {
+		// The kernel rewrites the ID field of unprivileged datagram ICMP
+		// sockets to the socket's local port, so that must be what we
+		// match replies against instead of the random p.id chosen at
+		// construction time.
+		if udpAddr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+			p.id = udpAddr.Port
+		}
+	}
+	return conn, nil
+}
+
+// SetPrivileged sets whether the Pinger uses a raw ICMP socket ("ip4:icmp"
+// / "ip6:ipv6-icmp", requires CAP_NET_RAW or root) or an unprivileged
+// ICMP-over-UDP datagram socket ("udp4"/"udp6").
+//
+// Unprivileged mode needs OS support: on Linux the process's group must
+// fall within net.ipv4.ping_group_range (and its IPv6 equivalent), and on
+// Darwin the kernel exposes ICMP directly as a SOCK_DGRAM. Windows has no
+// unprivileged ICMP mode. Run returns a descriptive error if raw mode is
+// requested without sufficient privileges.
+func (p *Pinger) SetPrivileged(privileged bool) {
+	if privileged {
+		p.network = "ip"
+	} else {
+		p.network = "udp"
+	}
+}
+
+// Privileged reports whether the Pinger is configured to use a raw ICMP
+// socket rather than unprivileged ICMP-over-UDP.
+func (p *Pinger) Privileged() bool {
+	return p.network == "ip"
+}
+
+// Network returns "ip" or "udp" depending on whether the Pinger is
+// configured to use raw or unprivileged sockets.
+func (p *Pinger) Network() string {
+	return p.network
+}
+
+// packetSize returns the total length of the ICMP echo payload: the caller
+// supplied Size, or just enough to carry the send timestamp and tracker.
+func (p *Pinger) packetSize() int {
+	if p.Size > timeSliceLen+trackerLen {
+		return p.Size
+	}
+	return timeSliceLen + trackerLen
+}
+
+// sendICMP builds and writes one ICMP echo request, stamping the payload
+// with the current time and p.Tracker so the matching reply can be
+// correlated back to this send in processPacket.
+func (p *Pinger) sendICMP(conn *icmp.PacketConn) error {
+	var typ icmp.Type
+	if p.ipv4 {
+		typ = ipv4.ICMPTypeEcho
+	} else {
+		typ = ipv6.ICMPTypeEchoRequest
 	}
-	return conn
+
+	var dst net.Addr = p.ipaddr
+	if p.network == "udp" {
+		dst = &net.UDPAddr{IP: p.ipaddr.IP, Zone: p.ipaddr.Zone}
+	}
+
+	data := append(timeToBytes(time.Now()), intToBytes(p.Tracker)...)
+	if remainSize := p.packetSize() - timeSliceLen - trackerLen; remainSize > 0 {
+		data = append(data, bytes.Repeat([]byte{1}, remainSize)...)
+	}
+
+	msg := &icmp.Message{
+		Type: typ,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:   p.id,
+			Seq:  p.sequence,
+			Data: data,
+		},
+	}
+
+	msgBytes, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.WriteTo(msgBytes, dst); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.PacketsSent++
+	p.mu.Unlock()
+	p.sequence++
+	return nil
+}
+
+// recvICMP reads raw packets off the socket and forwards them to recv until
+// p.done is closed, at which point it returns and signals wg.
+func (p *Pinger) recvICMP(conn *icmp.PacketConn, recv chan<- *packet, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		select {
+		case <-p.done:
+			return
+		default:
+			buf := make([]byte, p.packetSize()+128)
+			conn.SetReadDeadline(time.Now().Add(time.Millisecond * 100))
+
+			var n, ttl int
+			var err error
+			if p.ipv4 {
+				var cm *ipv4.ControlMessage
+				n, cm, _, err = conn.IPv4PacketConn().ReadFrom(buf)
+				if cm != nil {
+					ttl = cm.TTL
+				}
+			} else {
+				var cm *ipv6.ControlMessage
+				n, cm, _, err = conn.IPv6PacketConn().ReadFrom(buf)
+				if cm != nil {
+					ttl = cm.HopLimit
+				}
+			}
+			if err != nil {
+				if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
+					continue
+				}
+				p.Stop()
+				return
+			}
+
+			select {
+			case recv <- &packet{bytes: buf, nbytes: n, ttl: ttl}:
+			case <-p.done:
+				return
+			}
+		}
+	}
+}
+
+// processPacket parses a raw reply, verifies it is an echo reply addressed
+// to this Pinger's (id, tracker) pair, and invokes OnRecieve for it. A raw
+// ("ip") socket receives every ICMP packet on the host, not just replies to
+// this Pinger, so anything that fails to parse or doesn't match is simply
+// ignored rather than treated as fatal to Run.
+func (p *Pinger) processPacket(recv *packet) {
+	receivedAt := time.Now()
+
+	proto := protocolICMP
+	if !p.ipv4 {
+		proto = protocolIPv6ICMP
+	}
+
+	m, err := icmp.ParseMessage(proto, recv.bytes[:recv.nbytes])
+	if err != nil {
+		return
+	}
+
+	if m.Type != ipv4.ICMPTypeEchoReply && m.Type != ipv6.ICMPTypeEchoReply {
+		// Not an echo reply (e.g. a TimeExceeded from an intermediate hop); ignore it.
+		return
+	}
+
+	pkt, ok := m.Body.(*icmp.Echo)
+	if !ok {
+		return
+	}
+	if pkt.ID != p.id || len(pkt.Data) < timeSliceLen+trackerLen {
+		return
+	}
+	if bytesToInt(pkt.Data[timeSliceLen:timeSliceLen+trackerLen]) != p.Tracker {
+		return
+	}
+
+	outPkt := &Packet{
+		Nbytes:   recv.nbytes,
+		IPAddr:   p.ipaddr,
+		Addr:     p.addr,
+		TTL:      recv.ttl,
+		Sequence: pkt.Seq,
+		Rtt:      receivedAt.Sub(bytesToTime(pkt.Data[:timeSliceLen])),
+	}
+	p.mu.Lock()
+	p.PacketsRecieve++
+	p.rtts = append(p.rtts, outPkt.Rtt)
+	p.mu.Unlock()
+
+	if handler := p.OnRecieve; handler != nil {
+		handler(outPkt)
+	}
+}
+
+func timeToBytes(t time.Time) []byte {
+	nsec := t.UnixNano()
+	b := make([]byte, timeSliceLen)
+	for i := uint8(0); i < 8; i++ {
+		b[i] = byte((nsec >> ((7 - i) * 8)) & 0xff)
+	}
+	return b
+}
+
+func bytesToTime(b []byte) time.Time {
+	var nsec int64
+	for i := uint8(0); i < 8; i++ {
+		nsec += int64(b[i]) << ((7 - i) * 8)
+	}
+	return time.Unix(nsec/1000000000, nsec%1000000000)
+}
+
+func intToBytes(tracker int64) []byte {
+	b := make([]byte, trackerLen)
+	binary.BigEndian.PutUint64(b, uint64(tracker))
+	return b
+}
+
+func bytesToInt(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b))
 }
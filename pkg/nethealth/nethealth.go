@@ -0,0 +1,319 @@
+// Package nethealth continuously probes a set of peers with ICMP echo
+// requests and exports their reachability as Prometheus metrics, so it can
+// back a Kubernetes/overlay-network liveness or readiness check rather than
+// just printing to a terminal.
+package nethealth
+
+import (
+	"context"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	gp "github.com/frzam/gp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Peer is a single host to monitor, named by hostname or IP.
+type Peer struct {
+	Name string
+}
+
+// peerState is the per-peer bookkeeping needed between rounds: its current
+// resolved address, the sliding window of hit/miss results, and the
+// consecutive-miss count that drives the health transition.
+type peerState struct {
+	peer            Peer
+	addr            *net.IPAddr
+	recvThisRound   bool
+	consecutiveMiss int
+	healthy         bool
+	window          []bool
+}
+
+// Monitor continuously pings a configurable peer set over a gp.BatchPinger
+// and exposes per-peer loss, RTT, timeout and health-status metrics as a
+// prometheus.Collector.
+type Monitor struct {
+	// UnhealthyAfter is the number of consecutive missed replies after
+	// which a peer's status flips to unhealthy.
+	UnhealthyAfter int
+	// Window is the number of most recent rounds used to compute
+	// nethealth_packet_loss.
+	Window int
+	// ResolveInterval controls how often peer hostnames are re-resolved.
+	ResolveInterval time.Duration
+	// OnTransition, if set, is called whenever a peer crosses the
+	// UnhealthyAfter threshold in either direction.
+	OnTransition func(name string, healthy bool)
+
+	pinger *gp.BatchPinger
+
+	mu         sync.Mutex
+	peers      map[string]*peerState
+	addrToName map[string]string
+
+	done     chan struct{}
+	stopOnce sync.Once
+
+	loss     *prometheus.GaugeVec
+	rttHist  *prometheus.HistogramVec
+	timeouts *prometheus.CounterVec
+	status   *prometheus.GaugeVec
+}
+
+// NewMonitor returns a Monitor configured to probe peers. Call Run to start
+// probing and UpdatePeers to change the peer set afterwards.
+func NewMonitor(peers []Peer) *Monitor {
+	m := &Monitor{
+		UnhealthyAfter:  3,
+		Window:          10,
+		ResolveInterval: time.Minute,
+		pinger:          newContinuousBatchPinger(),
+		peers:           make(map[string]*peerState),
+		addrToName:      make(map[string]string),
+		done:            make(chan struct{}),
+		loss: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nethealth_packet_loss",
+			Help: "Fraction of echo requests lost to each peer over the sliding window.",
+		}, []string{"peer"}),
+		rttHist: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "nethealth_packet_rtt_seconds",
+			Help:    "Round-trip time of echo replies received from each peer.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"peer"}),
+		timeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nethealth_total_timeouts",
+			Help: "Total echo requests that went unanswered by each peer.",
+		}, []string{"peer"}),
+		status: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nethealth_peer_status",
+			Help: "1 if the peer is healthy, 0 if it has missed UnhealthyAfter consecutive replies.",
+		}, []string{"peer"}),
+	}
+	m.pinger.OnRecv = m.onRecv
+	m.UpdatePeers(peers)
+	return m
+}
+
+// newContinuousBatchPinger returns a BatchPinger with its Timeout disabled,
+// since Monitor's RunLoop is meant to keep probing for as long as the
+// process runs rather than stop after BatchPinger's default 100s.
+func newContinuousBatchPinger() *gp.BatchPinger {
+	b := gp.NewBatchPinger()
+	b.Timeout = time.Duration(math.MaxInt64)
+	return b
+}
+
+// Interval returns the time between probe rounds.
+func (m *Monitor) Interval() time.Duration {
+	return m.pinger.Interval
+}
+
+// SetInterval sets the time between probe rounds. Call before Run.
+func (m *Monitor) SetInterval(d time.Duration) {
+	m.pinger.Interval = d
+}
+
+// MaxRTT returns the idle window each round waits for replies before
+// evaluating peer health.
+func (m *Monitor) MaxRTT() time.Duration {
+	return m.pinger.MaxRTT
+}
+
+// SetMaxRTT sets the idle window each round waits for replies before
+// evaluating peer health. Call before Run.
+func (m *Monitor) SetMaxRTT(d time.Duration) {
+	m.pinger.MaxRTT = d
+}
+
+// UpdatePeers replaces the monitored peer set, adding and removing targets
+// on the underlying BatchPinger without restarting its sockets. It is safe
+// to call while Run is active.
+func (m *Monitor) UpdatePeers(peers []Peer) {
+	want := make(map[string]Peer, len(peers))
+	for _, p := range peers {
+		want[p.Name] = p
+	}
+
+	m.mu.Lock()
+	for name, ps := range m.peers {
+		if _, ok := want[name]; ok {
+			continue
+		}
+		if ps.addr != nil {
+			m.pinger.RemoveIPAddr(ps.addr)
+			delete(m.addrToName, ps.addr.IP.String())
+		}
+		delete(m.peers, name)
+		m.loss.DeleteLabelValues(name)
+		m.status.DeleteLabelValues(name)
+		m.timeouts.DeleteLabelValues(name)
+		m.rttHist.DeleteLabelValues(name)
+	}
+	for name, p := range want {
+		if _, ok := m.peers[name]; !ok {
+			m.peers[name] = &peerState{peer: p, healthy: true}
+		}
+	}
+	m.mu.Unlock()
+
+	m.resolvePeers()
+}
+
+// Stop ends a running Run. It is safe to call more than once.
+func (m *Monitor) Stop() {
+	m.stopOnce.Do(func() {
+		m.pinger.Stop()
+		close(m.done)
+	})
+}
+
+// Run probes every peer once per pinger.Interval and re-resolves peer
+// hostnames every ResolveInterval, until ctx is cancelled or Stop is
+// called. It drives the underlying BatchPinger with a single RunLoop call,
+// so the pair of ICMP sockets it opens are reused for the whole Run rather
+// than reopened every round.
+func (m *Monitor) Run(ctx context.Context) error {
+	m.pinger.OnIdle = m.evaluateRound
+
+	resolveTicker := time.NewTicker(m.ResolveInterval)
+	defer resolveTicker.Stop()
+
+	loopErr := make(chan error, 1)
+	go func() {
+		loopErr <- m.pinger.RunLoop()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.pinger.Stop()
+			return nil
+		case <-m.done:
+			return nil
+		case err := <-loopErr:
+			return err
+		case <-resolveTicker.C:
+			m.resolvePeers()
+		}
+	}
+}
+
+// resolvePeers re-resolves every peer's hostname and, when the resolved
+// address changes, swaps it on the underlying BatchPinger.
+func (m *Monitor) resolvePeers() {
+	m.mu.Lock()
+	states := make([]*peerState, 0, len(m.peers))
+	for _, ps := range m.peers {
+		states = append(states, ps)
+	}
+	m.mu.Unlock()
+
+	for _, ps := range states {
+		addr, err := net.ResolveIPAddr("ip", ps.peer.Name)
+		if err != nil {
+			continue
+		}
+
+		m.mu.Lock()
+		if ps.addr == nil || ps.addr.IP.String() != addr.IP.String() {
+			if ps.addr != nil {
+				m.pinger.RemoveIPAddr(ps.addr)
+				delete(m.addrToName, ps.addr.IP.String())
+			}
+			ps.addr = addr
+			m.addrToName[addr.IP.String()] = ps.peer.Name
+			m.pinger.AddIPAddr(addr)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// onRecv is registered as the BatchPinger's OnRecv callback; it marks the
+// owning peer as having answered this round and records its RTT.
+func (m *Monitor) onRecv(addr *net.IPAddr, rtt time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name, ok := m.addrToName[addr.IP.String()]
+	if !ok {
+		return
+	}
+	ps, ok := m.peers[name]
+	if !ok {
+		return
+	}
+	ps.recvThisRound = true
+	m.rttHist.WithLabelValues(name).Observe(rtt.Seconds())
+}
+
+// evaluateRound updates loss, timeout, and health-status metrics after a
+// round of BatchPinger.Run has completed, and fires OnTransition for any
+// peer whose health just changed.
+func (m *Monitor) evaluateRound() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, ps := range m.peers {
+		hit := ps.recvThisRound
+		ps.recvThisRound = false
+
+		if hit {
+			ps.consecutiveMiss = 0
+		} else {
+			ps.consecutiveMiss++
+			m.timeouts.WithLabelValues(name).Inc()
+		}
+
+		ps.window = append(ps.window, hit)
+		if len(ps.window) > m.Window {
+			ps.window = ps.window[len(ps.window)-m.Window:]
+		}
+		m.loss.WithLabelValues(name).Set(windowLoss(ps.window))
+
+		wasHealthy := ps.healthy
+		ps.healthy = ps.consecutiveMiss < m.UnhealthyAfter
+		statusVal := 0.0
+		if ps.healthy {
+			statusVal = 1
+		}
+		m.status.WithLabelValues(name).Set(statusVal)
+
+		if wasHealthy != ps.healthy {
+			if handler := m.OnTransition; handler != nil {
+				handler(name, ps.healthy)
+			}
+		}
+	}
+}
+
+func windowLoss(window []bool) float64 {
+	if len(window) == 0 {
+		return 0
+	}
+	miss := 0
+	for _, hit := range window {
+		if !hit {
+			miss++
+		}
+	}
+	return float64(miss) / float64(len(window))
+}
+
+// Describe implements prometheus.Collector.
+func (m *Monitor) Describe(ch chan<- *prometheus.Desc) {
+	m.loss.Describe(ch)
+	m.rttHist.Describe(ch)
+	m.timeouts.Describe(ch)
+	m.status.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Monitor) Collect(ch chan<- prometheus.Metric) {
+	m.loss.Collect(ch)
+	m.rttHist.Collect(ch)
+	m.timeouts.Collect(ch)
+	m.status.Collect(ch)
+}
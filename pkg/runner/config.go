@@ -0,0 +1,197 @@
+// Package runner implements gp's config-file driven check runner: hosts
+// grouped together, each group running one or more checks, with state
+// changes reported through callbacks and optional exec hooks.
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CheckPing is a "check ping" block: how a group's hosts are probed and how
+// many consecutive results are needed before a host is declared up or down.
+type CheckPing struct {
+	Interval time.Duration
+	Count    int
+	Timeout  time.Duration
+	Up       int
+	Down     int
+	Exec     string
+}
+
+// Group is a "monitor group" block: a named set of hosts sharing a check.
+type Group struct {
+	Name  string
+	Hosts []string
+	Check CheckPing
+}
+
+// Config is a fully parsed gp config file.
+type Config struct {
+	Groups []Group
+}
+
+var defaultCheck = CheckPing{
+	Interval: time.Second,
+	Count:    3,
+	Timeout:  time.Second * 5,
+	Up:       2,
+	Down:     3,
+}
+
+// ParseConfig parses gp's declarative config format:
+//
+//	# comment
+//	monitor group web {
+//	    host 10.0.0.1
+//	    host 10.0.0.2
+//	    check ping {
+//	        interval 5s
+//	        count 3
+//	        timeout 2s
+//	        up 2
+//	        down 3
+//	        exec /usr/local/bin/alert.sh
+//	    }
+//	}
+//
+// Any check ping field left unset falls back to a sensible default, so a
+// group can omit the check ping block entirely and still be monitored.
+func ParseConfig(r io.Reader) (*Config, error) {
+	cfg := &Config{}
+	scanner := bufio.NewScanner(r)
+
+	var group *Group
+	var check *CheckPing
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := stripComment(scanner.Text())
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case fields[0] == "}":
+			switch {
+			case check != nil:
+				check = nil
+			case group != nil:
+				cfg.Groups = append(cfg.Groups, *group)
+				group = nil
+			default:
+				return nil, fmt.Errorf("line %d: unexpected '}'", lineNum)
+			}
+
+		case check != nil:
+			key, val, _ := strings.Cut(strings.TrimSpace(line), " ")
+			if err := setCheckField(check, key, strings.TrimSpace(val)); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+
+		case group != nil:
+			switch fields[0] {
+			case "host":
+				if len(fields) != 2 {
+					return nil, fmt.Errorf("line %d: host requires exactly one address", lineNum)
+				}
+				group.Hosts = append(group.Hosts, fields[1])
+			case "check":
+				if len(fields) != 3 || fields[1] != "ping" || fields[2] != "{" {
+					return nil, fmt.Errorf("line %d: expected 'check ping {'", lineNum)
+				}
+				check = &group.Check
+			default:
+				return nil, fmt.Errorf("line %d: unexpected %q inside group", lineNum, fields[0])
+			}
+
+		case fields[0] == "monitor":
+			if len(fields) != 4 || fields[1] != "group" || fields[3] != "{" {
+				return nil, fmt.Errorf("line %d: expected 'monitor group <name> {'", lineNum)
+			}
+			group = &Group{Name: fields[2], Check: defaultCheck}
+
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %q", lineNum, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if group != nil {
+		return nil, fmt.Errorf("unexpected end of config: unterminated group %q", group.Name)
+	}
+
+	return cfg, nil
+}
+
+func stripComment(line string) string {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+func setCheckField(c *CheckPing, key, val string) error {
+	if val == "" {
+		return fmt.Errorf("%q requires a value", key)
+	}
+	switch key {
+	case "interval":
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("interval must be positive, got %q", val)
+		}
+		c.Interval = d
+	case "timeout":
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("timeout must be positive, got %q", val)
+		}
+		c.Timeout = d
+	case "count":
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return fmt.Errorf("count must be positive, got %q", val)
+		}
+		c.Count = n
+	case "up":
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return fmt.Errorf("up must be positive, got %q", val)
+		}
+		c.Up = n
+	case "down":
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return fmt.Errorf("down must be positive, got %q", val)
+		}
+		c.Down = n
+	case "exec":
+		c.Exec = val
+	default:
+		return fmt.Errorf("unknown check ping field %q", key)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfigValid(t *testing.T) {
+	const conf = `
+# comment at the top
+monitor group web {
+    host 10.0.0.1
+    host 10.0.0.2
+    check ping {
+        interval 5s
+        count 3
+        timeout 2s
+        up 2
+        down 3
+        exec /usr/local/bin/alert.sh
+    }
+}
+
+monitor group db {
+    host 10.0.1.1 # inline comment
+}
+`
+	cfg, err := ParseConfig(strings.NewReader(conf))
+	if err != nil {
+		t.Fatalf("ParseConfig returned error: %v", err)
+	}
+	if len(cfg.Groups) != 2 {
+		t.Fatalf("got %d groups, want 2", len(cfg.Groups))
+	}
+
+	web := cfg.Groups[0]
+	if web.Name != "web" {
+		t.Errorf("got group name %q, want %q", web.Name, "web")
+	}
+	if want := []string{"10.0.0.1", "10.0.0.2"}; !equalStrings(web.Hosts, want) {
+		t.Errorf("got hosts %v, want %v", web.Hosts, want)
+	}
+	wantCheck := CheckPing{
+		Interval: 5 * time.Second,
+		Count:    3,
+		Timeout:  2 * time.Second,
+		Up:       2,
+		Down:     3,
+		Exec:     "/usr/local/bin/alert.sh",
+	}
+	if web.Check != wantCheck {
+		t.Errorf("got check %+v, want %+v", web.Check, wantCheck)
+	}
+
+	db := cfg.Groups[1]
+	if db.Check != defaultCheck {
+		t.Errorf("group with no check block got %+v, want defaults %+v", db.Check, defaultCheck)
+	}
+}
+
+func TestParseConfigMalformedBraces(t *testing.T) {
+	cases := []string{
+		"monitor group web {\n    host 10.0.0.1\n", // missing closing brace
+		"monitor group web\n    host 10.0.0.1\n}\n", // missing opening brace
+		"}\n", // stray closing brace
+	}
+	for _, conf := range cases {
+		if _, err := ParseConfig(strings.NewReader(conf)); err == nil {
+			t.Errorf("ParseConfig(%q) = nil error, want error", conf)
+		}
+	}
+}
+
+func TestParseConfigUnknownField(t *testing.T) {
+	const conf = `
+monitor group web {
+    host 10.0.0.1
+    check ping {
+        bogus 5s
+    }
+}
+`
+	if _, err := ParseConfig(strings.NewReader(conf)); err == nil {
+		t.Error("ParseConfig with unknown check field = nil error, want error")
+	}
+}
+
+func TestParseConfigNonPositiveFields(t *testing.T) {
+	cases := map[string]string{
+		"interval": "interval 0s",
+		"timeout":  "timeout 0s",
+		"count":    "count 0",
+		"up":       "up 0",
+		"down":     "down 0",
+	}
+	for name, field := range cases {
+		conf := "monitor group web {\n    host 10.0.0.1\n    check ping {\n        " + field + "\n    }\n}\n"
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseConfig(strings.NewReader(conf)); err == nil {
+				t.Errorf("ParseConfig with %q = nil error, want error", field)
+			}
+		})
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+package runner
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	gp "github.com/frzam/gp"
+)
+
+// StateChange describes a host crossing its group's up/down threshold.
+type StateChange struct {
+	Group string
+	Host  string
+	Up    bool
+}
+
+// hostState is the consecutive-result bookkeeping a Runner keeps per host
+// to decide when it has crossed its group's Up/Down threshold.
+type hostState struct {
+	consecutiveUp   int
+	consecutiveDown int
+	up              bool
+}
+
+// Runner runs every group's check ping against every one of its hosts
+// concurrently, reporting crossings of the configured up/down threshold.
+type Runner struct {
+	Config *Config
+	// OnStateChange, if set, is called whenever a host crosses its
+	// group's up/down threshold.
+	OnStateChange func(StateChange)
+}
+
+// NewRunner returns a Runner for cfg.
+func NewRunner(cfg *Config) *Runner {
+	return &Runner{Config: cfg}
+}
+
+// Run checks every host in every group, each on its own goroutine and its
+// own state machine, until ctx is cancelled. A host that can't be resolved
+// or pinged is logged and retried rather than taking down the rest of the
+// runner -- one flaky or misconfigured host must not stop monitoring for
+// every other host.
+func (r *Runner) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+
+	for _, g := range r.Config.Groups {
+		for _, host := range g.Hosts {
+			g, host := g, host
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.runHostCheck(ctx, g, host)
+			}()
+		}
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+	return nil
+}
+
+// runHostCheck repeatedly runs a round of g.Check.Count pings against host,
+// waiting g.Check.Interval between rounds, updating state and reporting
+// threshold crossings as it goes, until ctx is cancelled. Any error for
+// this host -- a resolution failure, a socket failure -- is logged and
+// counted as unreachable for that round rather than returned, so the
+// failure stays local to this host's goroutine.
+func (r *Runner) runHostCheck(ctx context.Context, g Group, host string) {
+	state := &hostState{}
+
+	for {
+		reachable := false
+
+		pinger, err := gp.NewPinger(host)
+		if err != nil {
+			log.Printf("gp: group %s host %s: %v", g.Name, host, err)
+		} else {
+			pinger.Count = g.Check.Count
+			pinger.Interval = g.Check.Interval
+			pinger.Timeout = g.Check.Timeout
+
+			if err := pinger.Run(); err != nil {
+				log.Printf("gp: group %s host %s: %v", g.Name, host, err)
+			} else {
+				reachable = pinger.GenerateStats().PacketsRecieve > 0
+			}
+		}
+
+		r.evaluate(g, host, state, reachable)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(g.Check.Interval):
+		}
+	}
+}
+
+// evaluate folds one round's reachability into state and fires a
+// transition if the host has just crossed its group's up/down threshold.
+func (r *Runner) evaluate(g Group, host string, state *hostState, reachable bool) {
+	if reachable {
+		state.consecutiveUp++
+		state.consecutiveDown = 0
+	} else {
+		state.consecutiveDown++
+		state.consecutiveUp = 0
+	}
+
+	switch {
+	case !state.up && state.consecutiveUp >= g.Check.Up:
+		state.up = true
+		r.transition(g, host, true)
+	case state.up && state.consecutiveDown >= g.Check.Down:
+		state.up = false
+		r.transition(g, host, false)
+	}
+}
+
+func (r *Runner) transition(g Group, host string, up bool) {
+	if handler := r.OnStateChange; handler != nil {
+		handler(StateChange{Group: g.Name, Host: host, Up: up})
+	}
+	if g.Check.Exec == "" {
+		return
+	}
+
+	status := "down"
+	if up {
+		status = "up"
+	}
+	cmd := exec.Command("/bin/sh", "-c", g.Check.Exec)
+	cmd.Env = append(os.Environ(),
+		"GP_GROUP="+g.Name,
+		"GP_HOST="+host,
+		"GP_STATUS="+status,
+	)
+	if err := cmd.Run(); err != nil {
+		log.Printf("gp: exec hook for %s/%s failed: %v", g.Name, host, err)
+	}
+}
@@ -0,0 +1,199 @@
+package pg
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// probesPerHop is how many echo requests Traceroute sends at each TTL
+// before giving up on that hop, matching classic traceroute(8).
+const probesPerHop = 3
+
+// probeTimeout bounds how long Traceroute waits for a single probe's
+// reply. It is deliberately independent of Pinger.Timeout (the overall
+// Run session timeout, 100s by default) since a non-responding hop should
+// cost a few seconds, not minutes.
+const probeTimeout = 3 * time.Second
+
+// Hop is one responder discovered by Traceroute: either an intermediate
+// router answering with TimeExceeded, or the destination itself answering
+// with an EchoReply. A Hop with a nil Addr means every probe at that TTL
+// timed out; it is still recorded so the slice index plus one always
+// equals the TTL it was sent with.
+type Hop struct {
+	TTL  int
+	Addr net.Addr
+	Rtt  time.Duration
+	Type icmp.Type
+}
+
+// Traceroute sends echo requests with TTL/hop limit increasing from 1,
+// recording the fastest responder seen at each hop, until the destination
+// replies or maxHops is reached. It reuses the socket and control-message
+// setup Run uses to read back the TTL/hop limit of replies.
+//
+// Traceroute requires a raw ICMP socket: on an unprivileged ICMP-over-UDP
+// socket the kernel delivers a TimeExceeded as a socket error rather than a
+// readable datagram, so intermediate hops would never be observed. Call
+// SetPrivileged(true) before Traceroute.
+func (p *Pinger) Traceroute(maxHops int) ([]Hop, error) {
+	if !p.Privileged() {
+		return nil, fmt.Errorf("pg: Traceroute requires a raw ICMP socket; call SetPrivileged(true) first")
+	}
+
+	var conn *icmp.PacketConn
+	var err error
+	if p.ipv4 {
+		if conn, err = p.listen(ipv4Proto[p.network]); err != nil {
+			return nil, err
+		}
+		conn.IPv4PacketConn().SetControlMessage(ipv4.FlagTTL, true)
+	} else {
+		if conn, err = p.listen(ipv6Proto[p.network]); err != nil {
+			return nil, err
+		}
+		conn.IPv6PacketConn().SetControlMessage(ipv6.FlagHopLimit, true)
+	}
+	defer conn.Close()
+
+	var hops []Hop
+	for ttl := 1; ttl <= maxHops; ttl++ {
+		if p.ipv4 {
+			if err := conn.IPv4PacketConn().SetTTL(ttl); err != nil {
+				return hops, err
+			}
+		} else {
+			if err := conn.IPv6PacketConn().SetHopLimit(ttl); err != nil {
+				return hops, err
+			}
+		}
+
+		hop, reachedDest, err := p.probeHop(conn)
+		if err != nil {
+			return hops, err
+		}
+		if hop == nil {
+			// All probesPerHop at this TTL timed out; the hop may simply
+			// not respond to TimeExceeded. Still record it so the
+			// returned hops keep a 1:1 correspondence with TTL.
+			hop = &Hop{}
+		}
+		hop.TTL = ttl
+		hops = append(hops, *hop)
+		if reachedDest {
+			break
+		}
+	}
+	return hops, nil
+}
+
+// probeHop sends probesPerHop echo requests at the TTL already set on conn
+// and returns the fastest responder seen, along with whether it was the
+// destination itself.
+func (p *Pinger) probeHop(conn *icmp.PacketConn) (*Hop, bool, error) {
+	var best *Hop
+	var reachedDest bool
+
+	for i := 0; i < probesPerHop; i++ {
+		if err := p.sendICMP(conn); err != nil {
+			return best, reachedDest, err
+		}
+
+		conn.SetReadDeadline(time.Now().Add(probeTimeout))
+		buf := make([]byte, p.packetSize()+128)
+
+		var n int
+		var peer net.Addr
+		var err error
+		if p.ipv4 {
+			n, _, peer, err = conn.IPv4PacketConn().ReadFrom(buf)
+		} else {
+			n, _, peer, err = conn.IPv6PacketConn().ReadFrom(buf)
+		}
+		if err != nil {
+			if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
+				continue
+			}
+			return best, reachedDest, err
+		}
+
+		hop, isReply, ok := p.parseTracerouteReply(buf[:n], peer)
+		if !ok {
+			continue
+		}
+		if best == nil || hop.Rtt < best.Rtt {
+			best = hop
+		}
+		if isReply {
+			reachedDest = true
+		}
+	}
+	return best, reachedDest, nil
+}
+
+// parseTracerouteReply recognizes a TimeExceeded from an intermediate hop
+// or an EchoReply from the destination, verifying in both cases that it
+// answers one of our own probes via the embedded (id, tracker).
+func (p *Pinger) parseTracerouteReply(data []byte, peer net.Addr) (hop *Hop, isReply bool, ok bool) {
+	proto := protocolICMP
+	if !p.ipv4 {
+		proto = protocolIPv6ICMP
+	}
+	m, err := icmp.ParseMessage(proto, data)
+	if err != nil {
+		return nil, false, false
+	}
+
+	switch body := m.Body.(type) {
+	case *icmp.TimeExceeded:
+		id, ts, tracker, found := p.embeddedEcho(body.Data)
+		if !found || id != p.id || tracker != p.Tracker {
+			return nil, false, false
+		}
+		return &Hop{Addr: peer, Rtt: time.Since(ts), Type: m.Type}, false, true
+
+	case *icmp.Echo:
+		if m.Type != ipv4.ICMPTypeEchoReply && m.Type != ipv6.ICMPTypeEchoReply {
+			return nil, false, false
+		}
+		if body.ID != p.id || len(body.Data) < timeSliceLen+trackerLen {
+			return nil, false, false
+		}
+		if bytesToInt(body.Data[timeSliceLen:timeSliceLen+trackerLen]) != p.Tracker {
+			return nil, false, false
+		}
+		rtt := time.Since(bytesToTime(body.Data[:timeSliceLen]))
+		return &Hop{Addr: peer, Rtt: rtt, Type: m.Type}, true, true
+
+	default:
+		return nil, false, false
+	}
+}
+
+// embeddedEcho extracts the (id, send-time, tracker) of the echo request
+// quoted inside a TimeExceeded payload: the original IP header followed by
+// our original ICMP echo message.
+func (p *Pinger) embeddedEcho(raw []byte) (id int, ts time.Time, tracker int64, ok bool) {
+	hdrLen := 40
+	if p.ipv4 {
+		if len(raw) == 0 {
+			return 0, time.Time{}, 0, false
+		}
+		hdrLen = int(raw[0]&0x0f) * 4
+	}
+	if len(raw) < hdrLen+8+timeSliceLen+trackerLen {
+		return 0, time.Time{}, 0, false
+	}
+
+	icmpHdr := raw[hdrLen:]
+	id = int(icmpHdr[4])<<8 | int(icmpHdr[5])
+	echoData := icmpHdr[8:]
+	ts = bytesToTime(echoData[:timeSliceLen])
+	tracker = bytesToInt(echoData[timeSliceLen : timeSliceLen+trackerLen])
+	return id, ts, tracker, true
+}